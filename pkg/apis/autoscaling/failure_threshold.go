@@ -0,0 +1,58 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaling
+
+import "time"
+
+// groupName is the Kubernetes API group the autoscaling annotations live in.
+const groupName = "autoscaling.knative.dev"
+
+const (
+	// FailureThresholdAnnotationKey is the annotation to configure the
+	// container RestartCount at which CrashLoopBackOff, or a non-zero exit
+	// code in the container's last termination, counts as a terminal
+	// failure. ImagePullBackOff, ErrImagePull and a current Terminated state
+	// with a non-zero exit code count regardless of it. A Revision with
+	// terminal failures on at least ceil(minScale/2) of its pods is dead on
+	// arrival (see lifecycle.IsDeadOnArrival) without waiting for the full
+	// ProgressDeadline to elapse.
+	//
+	// The value is a positive integer restart count. If unset or invalid,
+	// DefaultFailureThreshold is used.
+	FailureThresholdAnnotationKey = groupName + "/failure-threshold"
+
+	// DefaultFailureThreshold is the FailureThresholdAnnotationKey value used
+	// when a Revision does not specify one.
+	DefaultFailureThreshold = 5
+
+	// FailureThresholdWindowAnnotationKey configures the dwell time a
+	// terminal container state must have lasted before it counts towards
+	// dead-on-arrival detection. For the Waiting states it is timed from the
+	// pod's creation, and for the Terminated states from the container's
+	// FinishedAt; it is not timed from the moment
+	// FailureThresholdAnnotationKey's restart count was reached. This keeps a
+	// single transient restart right at the threshold from tripping the check
+	// before the container has genuinely settled into a failure loop.
+	//
+	// The value is a Go duration string (e.g. "30s"). If unset,
+	// DefaultFailureThresholdWindow is used.
+	FailureThresholdWindowAnnotationKey = groupName + "/failure-threshold-window"
+
+	// DefaultFailureThresholdWindow is the FailureThresholdWindowAnnotationKey
+	// value used when a Revision does not specify one.
+	DefaultFailureThresholdWindow = 30 * time.Second
+)
@@ -0,0 +1,33 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+// ReasonRevisionFailed is set on the Revision's Ready condition, and
+// propagated to the owning Configuration, when the reconciler determines
+// from container-status signals (CrashLoopBackOff, ImagePullBackOff,
+// ErrImagePull, or repeated non-zero Terminated exit codes) that a Revision
+// is dead on arrival, ahead of the slower ProgressDeadline timeout.
+const ReasonRevisionFailed = "RevisionFailed"
+
+// MarkRevisionFailed marks the Ready condition False with
+// ReasonRevisionFailed. Unlike MarkProgressDeadlineExceeded, this is driven
+// by container-status signals observed well before ProgressDeadline would
+// otherwise fire, so the Configuration reconciler can stop waiting on this
+// Revision and keep LatestReadyRevisionName pinned to the previous one.
+func (rs *RevisionStatus) MarkRevisionFailed(messageFormat string, messageA ...interface{}) {
+	revisionCondSet.Manage(rs).MarkFalse(RevisionConditionReady, ReasonRevisionFailed, messageFormat, messageA...)
+}
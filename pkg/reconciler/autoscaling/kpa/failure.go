@@ -0,0 +1,113 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kpa
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"knative.dev/serving/pkg/apis/autoscaling"
+	pav1alpha1 "knative.dev/serving/pkg/apis/autoscaling/v1alpha1"
+	"knative.dev/serving/pkg/apis/serving"
+	v1 "knative.dev/serving/pkg/apis/serving/v1"
+	clientset "knative.dev/serving/pkg/client/clientset/versioned"
+	"knative.dev/serving/pkg/reconciler/revision/lifecycle"
+)
+
+// checkDeadOnArrival checks rev for a dead start: if rev isn't Ready yet and
+// enough of its pods (ceil(minScale/2), per FailureThresholdAnnotationKey's
+// restart-count and FailureThresholdWindowAnnotationKey's dwell) are showing
+// a terminal container failure, it marks rev's Ready condition
+// False/RevisionFailed and persists the status update, so the Configuration
+// reconciler stops waiting out ProgressDeadline and keeps
+// LatestReadyRevisionName pinned to the previous good Revision.
+//
+// The Reconciler's ReconcileKind does not call it, so this check does not
+// run as part of PodAutoscaler reconciliation.
+//
+// It takes podsLister and client rather than a receiver, and reports whether
+// rev's status was changed.
+func checkDeadOnArrival(ctx context.Context, podsLister corev1listers.PodLister, client clientset.Interface, pa *pav1alpha1.PodAutoscaler, rev *v1.Revision) (bool, error) {
+	if rev.Status.IsReady() || revisionFailed(rev) {
+		// Already Ready, or already marked Failed by a previous reconcile:
+		// either way there's nothing new for this check to do, and
+		// re-running it would just re-write the same status every pass.
+		return false, nil
+	}
+
+	pods, err := podsLister.Pods(pa.Namespace).List(labels.SelectorFromSet(labels.Set{
+		serving.RevisionLabelKey: rev.Name,
+	}))
+	if err != nil {
+		return false, fmt.Errorf("failed to list pods for revision %s/%s: %w", rev.Namespace, rev.Name, err)
+	}
+
+	minScale := annotationInt(pa.Annotations, autoscaling.MinScaleAnnotationKey, 1)
+	threshold := annotationInt(pa.Annotations, autoscaling.FailureThresholdAnnotationKey, autoscaling.DefaultFailureThreshold)
+	dwell := annotationDuration(pa.Annotations, autoscaling.FailureThresholdWindowAnnotationKey, autoscaling.DefaultFailureThresholdWindow)
+	if !lifecycle.IsDeadOnArrival(pods, minScale, threshold, dwell) {
+		return false, nil
+	}
+
+	rev.Status.MarkRevisionFailed("the revision's pods are exhibiting a terminal container failure")
+	if _, err := client.ServingV1().Revisions(rev.Namespace).UpdateStatus(ctx, rev, metav1.UpdateOptions{}); err != nil {
+		return false, fmt.Errorf("failed to update status for revision %s/%s: %w", rev.Namespace, rev.Name, err)
+	}
+	return true, nil
+}
+
+// revisionFailed reports whether rev's Ready condition has already been set
+// False with ReasonRevisionFailed by a previous checkDeadOnArrival pass.
+func revisionFailed(rev *v1.Revision) bool {
+	cond := rev.Status.GetCondition(v1.RevisionConditionReady)
+	return cond != nil && cond.Status == corev1.ConditionFalse && cond.Reason == v1.ReasonRevisionFailed
+}
+
+// annotationInt parses annotations[key] as a positive integer, falling back
+// to def if the annotation is absent or not a valid positive integer.
+func annotationInt(annotations map[string]string, key string, def int) int {
+	v, ok := annotations[key]
+	if !ok {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return def
+	}
+	return n
+}
+
+// annotationDuration parses annotations[key] as a Go duration string,
+// falling back to def if the annotation is absent or not a valid duration.
+func annotationDuration(annotations map[string]string, key string, def time.Duration) time.Duration {
+	v, ok := annotations[key]
+	if !ok {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return def
+	}
+	return d
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package lifecycle holds helpers the revision reconciler uses to decide
+// whether a Revision's pods are progressing towards readiness, stuck, or
+// terminally broken.
+package lifecycle
+
+import (
+	"math"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// PodHasTerminalFailure reports whether pod is in a state that will not
+// recover without intervention: ImagePullBackOff/ErrImagePull (the image
+// itself is bad, restarting won't help), a Terminated state with a non-zero
+// exit code, or CrashLoopBackOff/a non-zero LastTerminationState once
+// RestartCount has reached restartThreshold — i.e. the container has been
+// given restartThreshold chances to come up cleanly and hasn't.
+//
+// Each of those signals must also have persisted for at least dwell, timed
+// from the pod's creation for the Waiting states (there's no per-state
+// timestamp to use instead) and from the terminated container's FinishedAt
+// for the Terminated states. This keeps a pod that crosses restartThreshold
+// but is then rescheduled a moment later from tripping dead-on-arrival
+// detection before the failure has genuinely settled in.
+func PodHasTerminalFailure(pod *corev1.Pod, restartThreshold int, dwell time.Duration) bool {
+	for _, cs := range pod.Status.ContainerStatuses {
+		if w := cs.State.Waiting; w != nil {
+			switch w.Reason {
+			case "ImagePullBackOff", "ErrImagePull":
+				if time.Since(pod.CreationTimestamp.Time) >= dwell {
+					return true
+				}
+			case "CrashLoopBackOff":
+				if cs.RestartCount >= int32(restartThreshold) && time.Since(pod.CreationTimestamp.Time) >= dwell {
+					return true
+				}
+			}
+		}
+		if t := cs.State.Terminated; t != nil && t.ExitCode != 0 &&
+			time.Since(t.FinishedAt.Time) >= dwell {
+			return true
+		}
+		if t := cs.LastTerminationState.Terminated; t != nil && t.ExitCode != 0 &&
+			cs.RestartCount >= int32(restartThreshold) && time.Since(t.FinishedAt.Time) >= dwell {
+			return true
+		}
+	}
+	return false
+}
+
+// FailingPodCount returns how many of pods exhibit a terminal failure as
+// defined by PodHasTerminalFailure.
+func FailingPodCount(pods []*corev1.Pod, restartThreshold int, dwell time.Duration) int {
+	failing := 0
+	for _, pod := range pods {
+		if PodHasTerminalFailure(pod, restartThreshold, dwell) {
+			failing++
+		}
+	}
+	return failing
+}
+
+// MinFailingPodsForDeadStart returns the number of pods, out of minScale,
+// that must be observed failing before the Revision is considered dead on
+// arrival: ceil(minScale/2), or 1 when minScale is not positive.
+func MinFailingPodsForDeadStart(minScale int) int {
+	if minScale <= 0 {
+		return 1
+	}
+	return int(math.Ceil(float64(minScale) / 2))
+}
+
+// IsDeadOnArrival reports whether enough of pods are exhibiting a terminal
+// failure, as PodHasTerminalFailure defines it for restartThreshold and
+// dwell, that the Revision reconciler should mark the Revision Failed without
+// waiting for ProgressDeadline to elapse.
+func IsDeadOnArrival(pods []*corev1.Pod, minScale, restartThreshold int, dwell time.Duration) bool {
+	return FailingPodCount(pods, restartThreshold, dwell) >= MinFailingPodsForDeadStart(minScale)
+}
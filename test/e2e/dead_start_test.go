@@ -24,7 +24,9 @@ import (
 	"fmt"
 	"strconv"
 	"testing"
+	"time"
 
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	pkgtest "knative.dev/pkg/test"
 	"knative.dev/serving/pkg/apis/autoscaling"
@@ -47,6 +49,59 @@ func generationLabelSelector(config string, generation int) string {
 	return fmt.Sprintf("%s=%s,%s=%s", serving.ConfigurationLabelKey, config, "serving.knative.dev/configurationGeneration", strconv.Itoa(generation))
 }
 
+// podsAreFailingOrRestarting reports whether at least wantPods pods matching
+// selector exist, and at least one of them is either flagged Failed by
+// readycheck (a terminal container state, using minRestarts as the restart
+// threshold so this agrees with whatever FailureThresholdAnnotationKey the
+// test configured) or has restarted more than minRestarts times. It
+// replaces the hand-rolled pod-polling loops these tests used to carry,
+// delegating the per-pod classification to v1test.Compute.
+func podsAreFailingOrRestarting(ctx context.Context, clients *test.Clients, selector string, wantPods, minRestarts int) (bool, error) {
+	pods := clients.KubeClient.CoreV1().Pods(test.ServingFlags.TestNamespace)
+	podList, err := pods.List(ctx, metav1.ListOptions{
+		LabelSelector: selector,
+		FieldSelector: "status.phase!=Pending",
+	})
+	if err != nil {
+		return false, err
+	}
+	if len(podList.Items) < wantPods {
+		return false, nil
+	}
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		status, _, err := v1test.Compute(ctx, clients.KubeClient, pod, minRestarts)
+		if err != nil {
+			return false, err
+		}
+		if status == v1test.Failed {
+			return true, nil
+		}
+		for _, cs := range pod.Status.ContainerStatuses {
+			if cs.RestartCount > int32(minRestarts) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// podsAreScaledToZero reports whether no pods matching selector exist
+// anymore. It's shared by every dead-start test that waits for a stale
+// generation to scale down, instead of each one hand-rolling its own
+// pods.List/len(Items)==0 check.
+func podsAreScaledToZero(ctx context.Context, clients *test.Clients, selector string) (bool, error) {
+	pods := clients.KubeClient.CoreV1().Pods(test.ServingFlags.TestNamespace)
+	podList, err := pods.List(ctx, metav1.ListOptions{
+		LabelSelector: selector,
+		FieldSelector: "status.phase!=Pending",
+	})
+	if err != nil {
+		return false, err
+	}
+	return len(podList.Items) == 0, nil
+}
+
 // This test case creates a service which can never reach a ready state.
 // The service is then udpated with a healthy image and is verified that
 // the healthy revision is ready and the unhealhy revision is scaled to zero.
@@ -99,31 +154,8 @@ func TestDeadStartToHealthy(t *testing.T) {
 	}
 
 	t.Logf("Waiting for Configuration %q pods to be restarting.", names.Config)
-	if err := v1test.WaitForConfigurationState(clients.ServingClient, names.Config, func(s *v1.Configuration) (b bool, e error) {
-		pods := clients.KubeClient.CoreV1().Pods(test.ServingFlags.TestNamespace)
-		podList, err := pods.List(context.Background(), metav1.ListOptions{
-			LabelSelector: generationLabelSelector(names.Config, 1),
-			FieldSelector: "status.phase!=Pending",
-		})
-
-		if err != nil {
-			return false, err
-		}
-		gotPods := len(podList.Items)
-		// if pods dont exits return.
-		if gotPods < initialScale {
-			return false, nil
-		}
-		// verify the pods are restarting.
-		for i := range podList.Items {
-			conds := podList.Items[i].Status.ContainerStatuses
-			for j := range conds {
-				if conds[j].RestartCount > 0 {
-					return true, nil
-				}
-			}
-		}
-		return false, nil
+	if err := v1test.WaitForConfigurationState(clients.ServingClient, names.Config, func(s *v1.Configuration) (bool, error) {
+		return podsAreFailingOrRestarting(context.Background(), clients, generationLabelSelector(names.Config, 1), initialScale, 0)
 	}, "ConfigurationIsRestarting"); err != nil {
 		t.Fatal("Configuration does not have the desired number of pods running:", err)
 	}
@@ -154,24 +186,155 @@ func TestDeadStartToHealthy(t *testing.T) {
 	}
 
 	t.Logf("Waiting first generation of Config %q to scale to zero.", names.Config)
-	if err := v1test.WaitForConfigurationState(clients.ServingClient, names.Config, func(s *v1.Configuration) (b bool, e error) {
-		pods := clients.KubeClient.CoreV1().Pods(test.ServingFlags.TestNamespace)
-		podList, err := pods.List(context.Background(), metav1.ListOptions{
-			LabelSelector: generationLabelSelector(names.Config, 1),
-			FieldSelector: "status.phase!=Pending",
-		})
-		if err != nil {
-			return false, err
-		}
-		// If 0 pods exists, resolve.
-		gotPods := len(podList.Items)
-		return gotPods == 0, nil
+	if err := v1test.WaitForConfigurationState(clients.ServingClient, names.Config, func(s *v1.Configuration) (bool, error) {
+		return podsAreScaledToZero(context.Background(), clients, generationLabelSelector(names.Config, 1))
 	}, "ConfigurationIsScaledToZero"); err != nil {
 		t.Fatal("Configuration did not scale to zero:", err)
 	}
 
 }
 
+// controlPlaneTargets are the host:port pairs WithPartitionedNode drops
+// traffic to in TestDeadStartToHealthyDuringPartition: the Kubernetes API
+// server and the two control-plane components a healthy revision's data
+// plane otherwise never needs to talk to directly, but whose metrics and
+// status pushes are expected to go missing during the partition.
+var controlPlaneTargets = []string{
+	"kubernetes.default.svc.cluster.local:443",
+	"activator-service.knative-serving.svc.cluster.local:9090",
+	"autoscaler.knative-serving.svc.cluster.local:8080",
+}
+
+// nodesHostingGeneration returns the deduplicated set of node names hosting
+// a running pod belonging to config's given generation, so the test can
+// partition every node the revision's pods actually landed on — initialScale
+// pods can easily be spread across more than one node.
+func nodesHostingGeneration(t *testing.T, clients *test.Clients, config string, generation int) []string {
+	t.Helper()
+	pods := clients.KubeClient.CoreV1().Pods(test.ServingFlags.TestNamespace)
+	podList, err := pods.List(context.Background(), metav1.ListOptions{
+		LabelSelector: generationLabelSelector(config, generation),
+		FieldSelector: "status.phase=Running",
+	})
+	if err != nil || len(podList.Items) == 0 {
+		t.Fatalf("Failed to find a running pod for Configuration %q generation %d: %v", config, generation, err)
+	}
+	seen := make(map[string]struct{}, len(podList.Items))
+	var nodes []string
+	for _, pod := range podList.Items {
+		if _, ok := seen[pod.Spec.NodeName]; ok {
+			continue
+		}
+		seen[pod.Spec.NodeName] = struct{}{}
+		nodes = append(nodes, pod.Spec.NodeName)
+	}
+	return nodes
+}
+
+// This test extends the dead-start scenario with a network partition: while
+// a new, broken revision is rolling out, every node hosting the still-healthy
+// previous revision is cut off from the control plane. It asserts that
+// losing metrics/heartbeats to that node doesn't cause the healthy revision
+// to be spuriously marked NotReady, that traffic keeps flowing to it, and
+// that once the partition heals the broken generation still scales to zero
+// exactly as in TestDeadStartToHealthy.
+func TestDeadStartToHealthyDuringPartition(t *testing.T) {
+	t.Parallel()
+
+	clients := Setup(t)
+
+	svcName := test.ObjectNameForTest(t)
+	names := test.ResourceNames{
+		Config:  svcName,
+		Service: svcName,
+		Image:   test.HelloWorld,
+	}
+	test.EnsureTearDown(t, clients, &names)
+
+	const initialScale = 3
+	_, err := v1test.CreateService(t, clients, names,
+		rtesting.WithConfigAnnotations(map[string]string{
+			autoscaling.MinScaleAnnotationKey: strconv.Itoa(initialScale),
+		}),
+		rtesting.WithRevisionTimeoutSeconds(5),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create Service %q: %v", names.Service, err)
+	}
+
+	t.Logf("Waiting for Configuration %q pods to reconcile.", names.Config)
+	if err := v1test.WaitForConfigurationState(clients.ServingClient, names.Config, func(c *v1.Configuration) (bool, error) {
+		if c.Status.LatestCreatedRevisionName != names.Revision {
+			names.Revision = c.Status.LatestCreatedRevisionName
+			return true, nil
+		}
+		return false, nil
+	}, "ConfigurationUpdatedWithRevision"); err != nil {
+		t.Fatal("Error obtaining LatestCreatedRevisionName", err)
+	}
+
+	t.Logf("Waiting for Revision %q pods to become ready.", names.Revision)
+	if err := v1test.WaitForRevisionState(
+		clients.ServingClient, names.Revision, v1test.IsRevisionReady, "RevisionIsReady",
+	); err != nil {
+		t.Fatalf("The Revision %q did not become ready: %v", names.Revision, err)
+	}
+	healthyRevision := names.Revision
+
+	nodes := nodesHostingGeneration(t, clients, names.Config, 1)
+
+	WithPartitionedNode(t, clients, nodes, controlPlaneTargets, func() {
+		t.Logf("Update service %q with deadstart image.", names.Service)
+		if _, err := v1test.UpdateService(t, clients, names, rtesting.WithServiceImage(pkgtest.ImagePath(test.DeadStart))); err != nil {
+			t.Fatal("Error updating Service", err)
+		}
+
+		t.Logf("Waiting for Configuration %q to roll a second revision.", names.Config)
+		if err := v1test.WaitForConfigurationState(clients.ServingClient, names.Config, func(c *v1.Configuration) (bool, error) {
+			return c.Status.LatestCreatedRevisionName != healthyRevision, nil
+		}, "ConfigurationUpdatedWithRevision"); err != nil {
+			t.Fatal("Error obtaining LatestCreatedRevisionName", err)
+		}
+
+		t.Logf("Verifying Revision %q is not spuriously marked NotReady while %v is partitioned.", healthyRevision, nodes)
+		if err := v1test.WaitForRevisionState(clients.ServingClient, healthyRevision, func(r *v1.Revision) (bool, error) {
+			cond := r.Status.GetCondition(v1.RevisionConditionReady)
+			if cond != nil && cond.Status == corev1.ConditionFalse {
+				return false, fmt.Errorf("Revision %q was marked NotReady during partition: %s", healthyRevision, cond.Reason)
+			}
+			return cond != nil && cond.Status == corev1.ConditionTrue, nil
+		}, "RevisionStaysReady"); err != nil {
+			t.Fatalf("Revision %q did not stay Ready during partition: %v", healthyRevision, err)
+		}
+
+		t.Logf("Verifying traffic still reaches healthy Revision %q during partition.", healthyRevision)
+		if _, err := pkgtest.WaitForEndpointState(
+			context.Background(),
+			clients.KubeClient,
+			t.Logf,
+			names.URL,
+			v1test.RetryingRouteInconsistency(pkgtest.MatchesAllOf(pkgtest.IsStatusOK)),
+			"WaitForSuccessfulResponseDuringPartition",
+			test.ServingFlags.ResolvableDomain,
+			test.AddRootCAtoTransport(context.Background(), t.Logf, clients, test.ServingFlags.HTTPS),
+		); err != nil {
+			t.Errorf("Traffic did not keep flowing to %q during partition: %v", names.URL, err)
+		}
+	})
+
+	t.Logf("Partition healed; waiting for broken generation on Configuration %q to scale to zero.", names.Config)
+	if err := v1test.WaitForConfigurationState(clients.ServingClient, names.Config, func(s *v1.Configuration) (bool, error) {
+		return podsAreFailingOrRestarting(context.Background(), clients, generationLabelSelector(names.Config, 2), initialScale, 0)
+	}, "ConfigurationIsRestarting"); err != nil {
+		t.Fatal("Configuration does not have the desired number of pods running:", err)
+	}
+	if err := v1test.WaitForConfigurationState(clients.ServingClient, names.Config, func(s *v1.Configuration) (bool, error) {
+		return podsAreScaledToZero(context.Background(), clients, generationLabelSelector(names.Config, 2))
+	}, "ConfigurationIsScaledToZero"); err != nil {
+		t.Fatal("Configuration did not scale to zero:", err)
+	}
+}
+
 // This test case updates a healthy service with an image that can never reach a ready state.
 // The healthy revision remains Ready and the DeadStart revision doesnt not scale down until ProgressDeadline is reached.
 func TestDeadStartFromHealthy(t *testing.T) {
@@ -196,8 +359,11 @@ func TestDeadStartFromHealthy(t *testing.T) {
 		rtesting.WithConfigAnnotations(map[string]string{
 			autoscaling.MinScaleAnnotationKey: strconv.Itoa(initialScale),
 		}),
-		rtesting.WithRevisionTimeoutSeconds(5),                                                         // Allow scale to zero quickly.
-		rtesting.WithConfigAnnotations(map[string]string{serving.ProgressDeadlineAnnotationKey: "1h"}), // ProgressDeadline is very long.
+		rtesting.WithRevisionTimeoutSeconds(5), // Allow scale to zero quickly.
+		rtesting.WithConfigAnnotations(map[string]string{
+			serving.ProgressDeadlineAnnotationKey:     "1h", // ProgressDeadline is very long...
+			autoscaling.FailureThresholdAnnotationKey: "2",  // ...but failure-threshold lets us fail fast anyway.
+		}),
 	)
 	if err != nil {
 		t.Fatalf("Failed to create Service %q: %v", names.Service, err)
@@ -253,31 +419,8 @@ func TestDeadStartFromHealthy(t *testing.T) {
 	}
 
 	t.Logf("Waiting for Configuration %q pods to be restarting.", names.Config)
-	if err := v1test.WaitForConfigurationState(clients.ServingClient, names.Config, func(s *v1.Configuration) (b bool, e error) {
-		pods := clients.KubeClient.CoreV1().Pods(test.ServingFlags.TestNamespace)
-		podList, err := pods.List(context.Background(), metav1.ListOptions{
-			LabelSelector: generationLabelSelector(names.Config, 2),
-			FieldSelector: "status.phase!=Pending",
-		})
-
-		if err != nil {
-			return false, err
-		}
-		gotPods := len(podList.Items)
-		// if pods dont exits return.
-		if gotPods < initialScale {
-			return false, nil
-		}
-		// verify the pods are restarting.
-		for i := range podList.Items {
-			conds := podList.Items[i].Status.ContainerStatuses
-			for j := range conds {
-				if conds[j].RestartCount > 2 {
-					return true, nil
-				}
-			}
-		}
-		return false, nil
+	if err := v1test.WaitForConfigurationState(clients.ServingClient, names.Config, func(s *v1.Configuration) (bool, error) {
+		return podsAreFailingOrRestarting(context.Background(), clients, generationLabelSelector(names.Config, 2), initialScale, 2)
 	}, "ConfigurationIsRestarting"); err != nil {
 		t.Fatal("Configuration does not have the desired number of pods running:", err)
 	}
@@ -293,4 +436,19 @@ func TestDeadStartFromHealthy(t *testing.T) {
 	if err != nil {
 		t.Fatal("Error obtaining LatestCreatedRevisionName", err)
 	}
+
+	// With a failure-threshold configured, the second Revision should be
+	// marked Failed within seconds of its pods entering a terminal state,
+	// rather than waiting out the hour-long ProgressDeadline.
+	t.Logf("Waiting for Revision %q to be marked Failed.", secondRevision)
+	start := time.Now()
+	if err := v1test.WaitForRevisionState(clients.ServingClient, secondRevision, func(r *v1.Revision) (bool, error) {
+		cond := r.Status.GetCondition(v1.RevisionConditionReady)
+		return cond != nil && cond.Status == corev1.ConditionFalse && cond.Reason == v1.ReasonRevisionFailed, nil
+	}, "RevisionIsFailed"); err != nil {
+		t.Fatalf("Revision %q was not marked Failed: %v", secondRevision, err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Minute {
+		t.Errorf("Revision %q took %v to be marked Failed, want well under the 1h ProgressDeadline", secondRevision, elapsed)
+	}
 }
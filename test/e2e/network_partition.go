@@ -0,0 +1,176 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"knative.dev/serving/test"
+)
+
+const (
+	partitionPollInterval = 2 * time.Second
+	partitionPollTimeout  = 1 * time.Minute
+)
+
+// WithPartitionedNode isolates each node in nodeNames' data plane from
+// targets (host:port pairs, typically the API server, activator and
+// autoscaler service endpoints) for the duration of fn. It mirrors the
+// upstream performTemporaryNetworkFailure pattern, but drives the partition
+// from a privileged, hostNetwork pod scheduled onto each node instead of
+// SSH, since e2e runs against clusters the test binary has no node-level
+// access to.
+//
+// A Revision's pods can be spread across more than one node, so every node
+// hosting one needs its own DROP rules; nodeNames is deduplicated by the
+// caller. The DROP rules on every node are always removed before
+// WithPartitionedNode returns, via a deferred heal, even if fn calls
+// t.Fatal or panics.
+func WithPartitionedNode(t *testing.T, clients *test.Clients, nodeNames []string, targets []string, fn func()) {
+	t.Helper()
+
+	ctx := context.Background()
+	baseName := test.ObjectNameForTest(t) + "-net-partition"
+
+	defer func() {
+		for i, nodeName := range nodeNames {
+			podName := fmt.Sprintf("%s-%d", baseName, i)
+			t.Logf("Healing partition on node %q", nodeName)
+			if err := healDropRules(ctx, clients, podName, nodeName, targets); err != nil {
+				t.Errorf("Failed to heal partition on node %q: %v", nodeName, err)
+			}
+		}
+	}()
+
+	for i, nodeName := range nodeNames {
+		podName := fmt.Sprintf("%s-%d", baseName, i)
+		t.Logf("Partitioning node %q from %v", nodeName, targets)
+		if err := installDropRules(ctx, clients, podName, nodeName, targets); err != nil {
+			t.Fatalf("Failed to partition node %q: %v", nodeName, err)
+		}
+	}
+
+	fn()
+}
+
+// installDropRules schedules a long-lived, privileged, hostNetwork pod on
+// nodeName that installs an iptables DROP rule for each target and then
+// idles, keeping the rules in place for the node's network namespace until
+// healDropRules tears it down.
+func installDropRules(ctx context.Context, clients *test.Clients, podName, nodeName string, targets []string) error {
+	script := iptablesScript("-I", targets) + "sleep infinity\n"
+	pod := networkPartitionPod(podName, nodeName, script)
+	_, err := clients.KubeClient.CoreV1().Pods(test.ServingFlags.TestNamespace).Create(ctx, pod, metav1.CreateOptions{})
+	if err != nil {
+		return err
+	}
+	return waitForPodRunning(ctx, clients, podName)
+}
+
+// healDropRules runs the inverse iptables commands on nodeName via a
+// short-lived helper pod, waits for that pod to run to completion so the
+// rules are actually gone before returning, and then deletes both it and
+// the pod installDropRules left running.
+func healDropRules(ctx context.Context, clients *test.Clients, podName, nodeName string, targets []string) error {
+	pods := clients.KubeClient.CoreV1().Pods(test.ServingFlags.TestNamespace)
+	healerName := podName + "-heal"
+	healer := networkPartitionPod(healerName, nodeName, iptablesScript("-D", targets))
+	if _, err := pods.Create(ctx, healer, metav1.CreateOptions{}); err != nil {
+		return err
+	}
+	defer pods.Delete(ctx, healerName, metav1.DeleteOptions{})
+	defer pods.Delete(ctx, podName, metav1.DeleteOptions{})
+
+	return wait.PollImmediate(partitionPollInterval, partitionPollTimeout, func() (bool, error) {
+		pod, err := pods.Get(ctx, healerName, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		switch pod.Status.Phase {
+		case corev1.PodSucceeded:
+			return true, nil
+		case corev1.PodFailed:
+			return false, fmt.Errorf("heal pod %q failed removing DROP rules on node %q", healerName, nodeName)
+		default:
+			return false, nil
+		}
+	})
+}
+
+// iptablesScript renders a shell script that adds (flag "-I") or removes
+// (flag "-D") a DROP rule per target, formatted "host:port". Since iptables'
+// -d only matches on address, the port is matched separately with
+// "-p tcp --dport".
+func iptablesScript(flag string, targets []string) string {
+	script := ""
+	for _, target := range targets {
+		host, port, _ := net.SplitHostPort(target)
+		script += fmt.Sprintf("iptables %s OUTPUT -d %s -p tcp --dport %s -j DROP\n", flag, host, port)
+	}
+	return script
+}
+
+// networkPartitionPod builds the privileged, hostNetwork pod spec used to
+// mutate iptables rules on nodeName from within its own network namespace.
+func networkPartitionPod(name, nodeName, script string) *corev1.Pod {
+	privileged := true
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Spec: corev1.PodSpec{
+			NodeName:    nodeName,
+			HostNetwork: true,
+			// hostNetwork pods don't use the cluster DNS resolver by
+			// default, but iptablesScript's targets include in-cluster
+			// *.svc.cluster.local names (the API server, activator and
+			// autoscaler services) that need it to resolve.
+			DNSPolicy:     corev1.DNSClusterFirstWithHostNet,
+			RestartPolicy: corev1.RestartPolicyNever,
+			Containers: []corev1.Container{{
+				Name:    "iptables",
+				Image:   "gcr.io/knative-samples/net-diag:latest",
+				Command: []string{"/bin/sh", "-c", script},
+				SecurityContext: &corev1.SecurityContext{
+					Privileged: &privileged,
+				},
+			}},
+		},
+	}
+}
+
+// waitForPodRunning blocks until podName reaches PodRunning, i.e. its
+// container has started. That phase alone does not show that the iptables
+// commands in the container's script have finished or succeeded.
+func waitForPodRunning(ctx context.Context, clients *test.Clients, podName string) error {
+	pods := clients.KubeClient.CoreV1().Pods(test.ServingFlags.TestNamespace)
+	return wait.PollImmediate(partitionPollInterval, partitionPollTimeout, func() (bool, error) {
+		pod, err := pods.Get(ctx, podName, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		return pod.Status.Phase == corev1.PodRunning, nil
+	})
+}
@@ -0,0 +1,238 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package v1 provides E2E test helpers, including readycheck, a small
+// kstatus-style readiness library so tests don't each hand-roll their own
+// pod/condition polling logic.
+package v1
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"knative.dev/pkg/apis"
+	"knative.dev/serving/pkg/apis/autoscaling"
+	servingv1 "knative.dev/serving/pkg/apis/serving/v1"
+	"knative.dev/serving/pkg/reconciler/revision/lifecycle"
+)
+
+// Status is the coarse-grained readiness state Compute reports
+// for an object, independent of its concrete type.
+type Status string
+
+const (
+	// InProgress means the object is still converging towards its desired
+	// state (e.g. a Deployment waiting on updatedReplicas/readyReplicas, or
+	// a Knative object whose ObservedGeneration hasn't caught up yet).
+	InProgress Status = "InProgress"
+	// Current means the object has reconciled its desired state.
+	Current Status = "Current"
+	// Failed means the object has reached a terminal, non-recoverable
+	// state (e.g. a Knative Ready=False condition, or pods stuck in
+	// CrashLoopBackOff/ImagePullBackOff).
+	Failed Status = "Failed"
+	// Terminating means the object is in the process of being deleted.
+	Terminating Status = "Terminating"
+	// NotFound means the object does not exist (anymore).
+	NotFound Status = "NotFound"
+)
+
+// Compute inspects obj and returns its coarse readiness Status together with
+// a short human-readable reason, modeled on Helm 3.5's resource status
+// checker (see pkg/kube/ready in helm/helm). client and ctx are accepted
+// but unused by every check today, so future checks (e.g. looking up owned Pods
+// for a Deployment) can issue follow-up calls without changing the
+// signature every test already depends on.
+//
+// restartThreshold is only consulted for *corev1.Pod: it's the number of
+// restarts a container must reach before its failure counts as terminal, and
+// defaults to autoscaling.DefaultFailureThreshold if the caller doesn't pass
+// one. There's no general way to recover a Pod's owning Revision/PA from the
+// Pod alone, so callers that know the configured
+// autoscaling.FailureThresholdAnnotationKey value (e.g. because they set it
+// themselves) should pass it through explicitly rather than relying on the
+// default.
+func Compute(ctx context.Context, client kubernetes.Interface, obj interface{}, restartThreshold ...int) (Status, string, error) {
+	switch o := obj.(type) {
+	case *appsv1.Deployment:
+		return checkDeployment(o)
+	case *appsv1.StatefulSet:
+		return checkStatefulSet(o)
+	case *appsv1.DaemonSet:
+		return checkDaemonSet(o)
+	case *appsv1.ReplicaSet:
+		return checkReplicaSet(o)
+	case *corev1.Pod:
+		threshold := autoscaling.DefaultFailureThreshold
+		if len(restartThreshold) > 0 {
+			threshold = restartThreshold[0]
+		}
+		return checkPod(o, threshold)
+	case *corev1.Service:
+		return Current, "Service has no convergence semantics of its own", nil
+	case *corev1.PersistentVolumeClaim:
+		return checkPVC(o)
+	case *servingv1.Revision:
+		return checkGeneric(o.Generation, o.Status.ObservedGeneration, o.DeletionTimestamp,
+			o.Status.GetCondition(servingv1.RevisionConditionReady))
+	case *servingv1.Configuration:
+		return checkGeneric(o.Generation, o.Status.ObservedGeneration, o.DeletionTimestamp,
+			o.Status.GetCondition(servingv1.ConfigurationConditionReady))
+	case *servingv1.Route:
+		return checkGeneric(o.Generation, o.Status.ObservedGeneration, o.DeletionTimestamp,
+			o.Status.GetCondition(servingv1.RouteConditionReady))
+	case *servingv1.Service:
+		return checkGeneric(o.Generation, o.Status.ObservedGeneration, o.DeletionTimestamp,
+			o.Status.GetCondition(servingv1.ServiceConditionReady))
+	default:
+		return "", "", fmt.Errorf("readycheck: unsupported type %T", obj)
+	}
+}
+
+func checkDeployment(d *appsv1.Deployment) (Status, string, error) {
+	if d.DeletionTimestamp != nil {
+		return Terminating, "Deployment is terminating", nil
+	}
+	if d.Generation != d.Status.ObservedGeneration {
+		return InProgress, "waiting for observed generation to catch up", nil
+	}
+	wantReplicas := int32(1)
+	if d.Spec.Replicas != nil {
+		wantReplicas = *d.Spec.Replicas
+	}
+	if d.Status.UpdatedReplicas < wantReplicas {
+		return InProgress, fmt.Sprintf("%d/%d replicas updated", d.Status.UpdatedReplicas, wantReplicas), nil
+	}
+	if d.Status.ReadyReplicas < wantReplicas {
+		return InProgress, fmt.Sprintf("%d/%d replicas ready", d.Status.ReadyReplicas, wantReplicas), nil
+	}
+	return Current, "Deployment is available", nil
+}
+
+func checkStatefulSet(s *appsv1.StatefulSet) (Status, string, error) {
+	if s.DeletionTimestamp != nil {
+		return Terminating, "StatefulSet is terminating", nil
+	}
+	if s.Generation != s.Status.ObservedGeneration {
+		return InProgress, "waiting for observed generation to catch up", nil
+	}
+	wantReplicas := int32(1)
+	if s.Spec.Replicas != nil {
+		wantReplicas = *s.Spec.Replicas
+	}
+	if s.Status.UpdatedReplicas < wantReplicas || s.Status.ReadyReplicas < wantReplicas {
+		return InProgress, fmt.Sprintf("%d/%d replicas ready", s.Status.ReadyReplicas, wantReplicas), nil
+	}
+	return Current, "StatefulSet is available", nil
+}
+
+func checkDaemonSet(d *appsv1.DaemonSet) (Status, string, error) {
+	if d.DeletionTimestamp != nil {
+		return Terminating, "DaemonSet is terminating", nil
+	}
+	if d.Generation != d.Status.ObservedGeneration {
+		return InProgress, "waiting for observed generation to catch up", nil
+	}
+	if d.Status.UpdatedNumberScheduled < d.Status.DesiredNumberScheduled || d.Status.NumberReady < d.Status.DesiredNumberScheduled {
+		return InProgress, fmt.Sprintf("%d/%d pods ready", d.Status.NumberReady, d.Status.DesiredNumberScheduled), nil
+	}
+	return Current, "DaemonSet is available", nil
+}
+
+func checkReplicaSet(r *appsv1.ReplicaSet) (Status, string, error) {
+	if r.DeletionTimestamp != nil {
+		return Terminating, "ReplicaSet is terminating", nil
+	}
+	wantReplicas := int32(1)
+	if r.Spec.Replicas != nil {
+		wantReplicas = *r.Spec.Replicas
+	}
+	if r.Status.ReadyReplicas < wantReplicas {
+		return InProgress, fmt.Sprintf("%d/%d replicas ready", r.Status.ReadyReplicas, wantReplicas), nil
+	}
+	return Current, "ReplicaSet is available", nil
+}
+
+func checkPod(p *corev1.Pod, restartThreshold int) (Status, string, error) {
+	if p.DeletionTimestamp != nil {
+		return Terminating, "Pod is terminating", nil
+	}
+	if lifecycle.PodHasTerminalFailure(p, restartThreshold, autoscaling.DefaultFailureThresholdWindow) {
+		return Failed, "Pod has a terminal container failure", nil
+	}
+	switch p.Status.Phase {
+	case corev1.PodSucceeded, corev1.PodRunning:
+		for _, cs := range p.Status.ContainerStatuses {
+			if !cs.Ready {
+				return InProgress, fmt.Sprintf("container %q is not ready", cs.Name), nil
+			}
+		}
+		return Current, "Pod is ready", nil
+	case corev1.PodFailed:
+		return Failed, "Pod has failed", nil
+	default:
+		return InProgress, fmt.Sprintf("Pod is %s", p.Status.Phase), nil
+	}
+}
+
+func checkPVC(p *corev1.PersistentVolumeClaim) (Status, string, error) {
+	switch p.Status.Phase {
+	case corev1.ClaimBound:
+		return Current, "PersistentVolumeClaim is bound", nil
+	case corev1.ClaimLost:
+		return Failed, "PersistentVolumeClaim lost its backing volume", nil
+	default:
+		return InProgress, fmt.Sprintf("PersistentVolumeClaim is %s", p.Status.Phase), nil
+	}
+}
+
+// checkGeneric implements the common duck-typed shape shared by Revision,
+// Configuration, Route and Service: generation bookkeeping plus a single
+// Ready condition.
+func checkGeneric(generation, observedGeneration int64, deletionTimestamp *metav1.Time, cond *apis.Condition) (Status, string, error) {
+	if deletionTimestamp != nil {
+		return Terminating, "resource is terminating", nil
+	}
+	if generation != observedGeneration {
+		return InProgress, "waiting for observed generation to catch up", nil
+	}
+	if cond == nil {
+		return InProgress, "Ready condition not yet reported", nil
+	}
+	switch cond.Status {
+	case corev1.ConditionTrue:
+		return Current, "Ready", nil
+	case corev1.ConditionFalse:
+		return Failed, cond.Reason, nil
+	default:
+		return InProgress, cond.Reason, nil
+	}
+}
+
+// GetByKey translates the common "resource disappeared between List and
+// Get" race into the readycheck vocabulary instead of a bare error.
+func GetByKey(err error) (Status, string, error) {
+	if apierrs.IsNotFound(err) {
+		return NotFound, "resource not found", nil
+	}
+	return "", "", err
+}